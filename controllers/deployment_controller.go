@@ -17,14 +17,48 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	appv1beta1 "github.com/odoo-operator/app-operator/api/v1beta1"
 )
 
+var (
+	wavePromotionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "app_operator_deployment_wave_promotions_total",
+		Help: "Number of times a Deployment was promoted to its next wave.",
+	}, []string{"namespace", "name"})
+
+	waveRollbacksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "app_operator_deployment_rollbacks_total",
+		Help: "Number of times a Deployment was rolled back to its previous Release.",
+	}, []string{"namespace", "name"})
+
+	timeInWaveSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "app_operator_deployment_time_in_wave_seconds",
+		Help:    "Time spent waiting on analysis before a wave was promoted or rolled back.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"namespace", "name"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(wavePromotionsTotal, waveRollbacksTotal, timeInWaveSeconds)
+}
+
 // DeploymentReconciler reconciles a Deployment object
 type DeploymentReconciler struct {
 	client.Client
@@ -33,18 +67,412 @@ type DeploymentReconciler struct {
 
 // +kubebuilder:rbac:groups=app.odoo.io,resources=deployments,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=app.odoo.io,resources=deployments/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=app.odoo.io,resources=odooinstances,verbs=get;list;watch
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
 
 func (r *DeploymentReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	_ = context.Background()
-	_ = r.Log.WithValues("deployment", req.NamespacedName)
+	ctx := context.Background()
+	log := r.Log.WithValues("deployment", req.NamespacedName)
+
+	deployment := &appv1beta1.Deployment{}
+	if err := r.Get(ctx, req.NamespacedName, deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if deployment.Spec.Strategy == appv1beta1.DeploymentStrategyRecreate {
+		return r.reconcileRecreate(ctx, log, deployment)
+	}
+
+	return r.reconcileProgressive(ctx, log, deployment)
+}
+
+// reconcileRecreate applies the target Release to every instance in one shot,
+// with no wave gating. It exists for dev/staging environments that would
+// rather take the downtime than wait on analysis intervals.
+func (r *DeploymentReconciler) reconcileRecreate(ctx context.Context, log logr.Logger, deployment *appv1beta1.Deployment) (ctrl.Result, error) {
+	targets, err := r.listTargetInstances(ctx, deployment)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	for i := range targets.Items {
+		if err := r.pinInstanceToRelease(ctx, &targets.Items[i], deployment.Spec.ReleaseRef); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	deployment.Status.PreviousReleaseRef = deployment.Spec.ReleaseRef
+	deployment.SetStatusConditionAvailable()
+	return ctrl.Result{}, r.Status().Update(ctx, deployment)
+}
+
+// reconcileProgressive walks Spec.Waves in order, pausing between each one to
+// poll the status of every instance in the current wave and the
+// copier/migration Jobs it depends on. A wave is only promoted once all of its
+// members report Created/Ready/Migrated; anything short of that past AnalysisInterval
+// triggers a rollback to Status.PreviousReleaseRef instead of a retry, since a
+// stuck wave is far more likely to be a bad Release than a slow one.
+func (r *DeploymentReconciler) reconcileProgressive(ctx context.Context, log logr.Logger, deployment *appv1beta1.Deployment) (ctrl.Result, error) {
+	if deployment.Status.FailedReleaseRef != (appv1beta1.ReleaseReference{}) && deployment.Status.FailedReleaseRef == deployment.Spec.ReleaseRef {
+		// This exact Release already failed wave analysis and was rolled
+		// back (or held in place, if there was nothing to roll back to).
+		// Without this guard, CurrentWave == 0 just restarts wave 0 against
+		// the identical broken Release on every resync, flapping between
+		// "re-pin" and "roll back" forever. Wait for Spec.ReleaseRef to
+		// change before trying again.
+		return ctrl.Result{}, nil
+	}
 
-	// your logic here
+	wave := deployment.Status.CurrentWave
+	if wave >= len(deployment.Spec.Waves) {
+		deployment.SetStatusConditionAvailable()
+		return ctrl.Result{}, r.Status().Update(ctx, deployment)
+	}
 
-	return ctrl.Result{}, nil
+	percentage := deployment.Spec.Waves[wave]
+
+	targets, err := r.listTargetInstances(ctx, deployment)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	record := currentWaveRecord(deployment, wave)
+
+	var inWave []*appv1beta1.OdooInstance
+	if record == nil {
+		// First time we've seen this wave: pick its membership once, record
+		// the instance names in WaveHistory, and reuse that fixed set for
+		// every later reconcile of this wave. Re-deriving membership from a
+		// fresh List() on every reconcile would let cache churn or scaling
+		// silently swap which instances are tracked mid-wave.
+		inWave = selectWaveMembers(targets.Items, percentage, deployment.Spec.MaxUnavailable)
+		log.Info("starting wave", "wave", wave, "percentage", percentage, "targets", len(inWave))
+		for i := range inWave {
+			if err := r.pinInstanceToRelease(ctx, inWave[i], deployment.Spec.ReleaseRef); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		deployment.Status.WaveHistory = append(deployment.Status.WaveHistory, appv1beta1.WaveRecord{
+			Wave:       wave,
+			Percentage: percentage,
+			StartTime:  metav1Now(),
+			Members:    instanceNames(inWave),
+		})
+		deployment.SetStatusConditionProgressing(fmt.Sprintf("wave %d (%d%%) started", wave, percentage))
+		return ctrl.Result{Requeue: true}, r.Status().Update(ctx, deployment)
+	}
+
+	inWave = membersByName(targets.Items, record.Members)
+	if len(inWave) != len(record.Members) {
+		log.Info("some instances pinned at wave start are no longer listed", "wave", wave, "want", len(record.Members), "found", len(inWave))
+	}
+
+	allHealthy, anyFailed, err := r.pollWaveHealth(ctx, inWave, deployment.Spec.ReleaseRef, record.StartTime.Time)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	analysisElapsed := time.Since(record.StartTime.Time)
+
+	switch {
+	case allHealthy:
+		timeInWaveSeconds.WithLabelValues(deployment.Namespace, deployment.Name).Observe(analysisElapsed.Seconds())
+		record.CompletionTime = metav1Now()
+		record.Outcome = "Promoted"
+		deployment.Status.CurrentWave = wave + 1
+		deployment.Status.PreviousReleaseRef = deployment.Spec.ReleaseRef
+		wavePromotionsTotal.WithLabelValues(deployment.Namespace, deployment.Name).Inc()
+		log.Info("wave promoted", "wave", wave, "percentage", percentage)
+		deployment.SetStatusConditionProgressing(fmt.Sprintf("wave %d (%d%%) promoted", wave, percentage))
+		return ctrl.Result{Requeue: true}, r.Status().Update(ctx, deployment)
+
+	case anyFailed || analysisElapsed > deployment.Spec.AnalysisInterval.Duration:
+		timeInWaveSeconds.WithLabelValues(deployment.Namespace, deployment.Name).Observe(analysisElapsed.Seconds())
+		record.CompletionTime = metav1Now()
+		record.Outcome = "RolledBack"
+		waveRollbacksTotal.WithLabelValues(deployment.Namespace, deployment.Name).Inc()
+		log.Info("wave failed analysis, rolling back", "wave", wave, "percentage", percentage, "anyFailed", anyFailed)
+		if deployment.Status.PreviousReleaseRef == (appv1beta1.ReleaseReference{}) {
+			// No prior successful promotion exists (this was the Deployment's
+			// very first wave). Re-pinning to the zero value would blank
+			// Spec.ReleaseRef on every target, so leave the instances on the
+			// Release this wave pinned them to and just stop.
+			log.Info("no previous release to roll back to, leaving instances as-is", "wave", wave)
+		} else {
+			for i := range inWave {
+				if err := r.pinInstanceToRelease(ctx, inWave[i], deployment.Status.PreviousReleaseRef); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+		}
+		deployment.Status.CurrentWave = 0
+		// Remember that this Release already failed so reconcileProgressive
+		// doesn't immediately restart wave 0 against it on the next resync.
+		deployment.Status.FailedReleaseRef = deployment.Spec.ReleaseRef
+		deployment.SetStatusConditionRolledBack(fmt.Sprintf("wave %d (%d%%) failed analysis", wave, percentage))
+		return ctrl.Result{}, r.Status().Update(ctx, deployment)
+
+	default:
+		// Still within the analysis window, nothing converged yet. Poll again shortly.
+		return ctrl.Result{RequeueAfter: 15 * time.Second}, nil
+	}
+}
+
+// listTargetInstances resolves Spec.Targets (individual OdooInstance
+// references and/or a Cluster selector) into the concrete set of
+// OdooInstances this Deployment rolls out to. The two are unioned: an
+// instance is a target if it's named in InstanceRefs OR matches
+// ClusterSelector, so naming specific instances with no selector set rolls
+// out to exactly those instances rather than falling back to "everything in
+// the namespace".
+func (r *DeploymentReconciler) listTargetInstances(ctx context.Context, deployment *appv1beta1.Deployment) (*appv1beta1.OdooInstanceList, error) {
+	targets := deployment.Spec.Targets
+
+	all := &appv1beta1.OdooInstanceList{}
+	if err := r.List(ctx, all, client.InNamespace(deployment.Namespace)); err != nil {
+		return nil, err
+	}
+
+	if targets.ClusterSelector == nil && len(targets.InstanceRefs) == 0 {
+		return all, nil
+	}
+
+	var selector labels.Selector
+	if targets.ClusterSelector != nil {
+		s, err := metav1.LabelSelectorAsSelector(targets.ClusterSelector)
+		if err != nil {
+			return nil, fmt.Errorf("parsing cluster selector: %w", err)
+		}
+		selector = s
+	}
+	named := make(map[string]bool, len(targets.InstanceRefs))
+	for _, ref := range targets.InstanceRefs {
+		named[ref.Name] = true
+	}
+
+	instances := &appv1beta1.OdooInstanceList{}
+	for _, instance := range all.Items {
+		if named[instance.Name] || (selector != nil && selector.Matches(labels.Set(instance.Labels))) {
+			instances.Items = append(instances.Items, instance)
+		}
+	}
+	return instances, nil
+}
+
+// pinInstanceToRelease patches the instance's ReleaseRef to releaseRef and
+// lets the OdooInstance reconciler drive the actual upgrade/migration Job.
+func (r *DeploymentReconciler) pinInstanceToRelease(ctx context.Context, instance *appv1beta1.OdooInstance, releaseRef appv1beta1.ReleaseReference) error {
+	if instance.Spec.ReleaseRef == releaseRef {
+		return nil
+	}
+	patch := client.MergeFrom(instance.DeepCopy())
+	instance.Spec.ReleaseRef = releaseRef
+	return r.Patch(ctx, instance, patch)
+}
+
+// pollWaveHealth aggregates per-instance status conditions and the Jobs that
+// back them into a single allHealthy/anyFailed verdict for the wave.
+func (r *DeploymentReconciler) pollWaveHealth(ctx context.Context, members []*appv1beta1.OdooInstance, releaseRef appv1beta1.ReleaseReference, waveStart time.Time) (allHealthy bool, anyFailed bool, err error) {
+	allHealthy = true
+	for _, instance := range members {
+		if instance.Spec.ReleaseRef != releaseRef {
+			allHealthy = false
+			continue
+		}
+		created := instance.GetStatusCondition(appv1beta1.OdooInstanceStatusConditionTypeCreated)
+		ready := instance.GetStatusCondition(appv1beta1.OdooInstanceStatusConditionTypeReady)
+		migrated := instance.GetStatusCondition(appv1beta1.OdooInstanceStatusConditionTypeMigrated)
+
+		if created == nil || ready == nil || migrated == nil {
+			allHealthy = false
+		} else if created.Status != appv1beta1.ConditionTrue || ready.Status != appv1beta1.ConditionTrue || migrated.Status != appv1beta1.ConditionTrue {
+			allHealthy = false
+		}
+
+		jobs := &batchv1.JobList{}
+		if err := r.List(ctx, jobs, client.InNamespace(instance.Namespace), client.MatchingLabels{
+			"instance.odoo.io/name": instance.Name,
+		}); err != nil {
+			return false, false, err
+		}
+		for i := range jobs.Items {
+			job := &jobs.Items[i]
+			// instance.odoo.io/name is shared with the snapshot component's
+			// backup CronJob/Job and, for copier Jobs specifically, left
+			// around on failure "for debugging purposes" long after this
+			// wave started. Neither should ever gate wave analysis: a
+			// failed nightly backup would roll back an unrelated, healthy
+			// wave, and a months-old failed clone Job would permanently
+			// poison every future wave for this instance.
+			if job.Labels["app.odoo.io/component"] == "snapshot" {
+				continue
+			}
+			if job.CreationTimestamp.Time.Before(waveStart) {
+				continue
+			}
+			if job.Status.Failed > 0 {
+				anyFailed = true
+			}
+		}
+	}
+	return allHealthy, anyFailed, nil
+}
+
+// currentWaveRecord returns the still-open (no CompletionTime) WaveHistory
+// entry for wave, or nil if that wave hasn't been started yet. Callers must
+// treat the returned pointer as aliasing deployment.Status.WaveHistory.
+func currentWaveRecord(deployment *appv1beta1.Deployment, wave int) *appv1beta1.WaveRecord {
+	for i := range deployment.Status.WaveHistory {
+		rec := &deployment.Status.WaveHistory[i]
+		if rec.Wave == wave && rec.CompletionTime.IsZero() {
+			return rec
+		}
+	}
+	return nil
+}
+
+// selectWaveMembers deterministically picks the subset of instances that
+// should be on releaseRef for the given wave percentage. When total minus
+// maxUnavailable is positive, the count is capped at that value, so
+// maxUnavailable instances are left out of every wave, a 100% wave included.
+// Instances are sorted by name first so that the same input set always
+// yields the same members regardless of the (unordered, cache-backed)
+// order List() happened to return them in; the caller is expected to
+// persist the resulting names (see instanceNames/membersByName) rather than
+// call this again for the same wave.
+func selectWaveMembers(instances []appv1beta1.OdooInstance, percentage int32, maxUnavailable int32) []*appv1beta1.OdooInstance {
+	total := len(instances)
+	if total == 0 {
+		return nil
+	}
+	sorted := make([]*appv1beta1.OdooInstance, total)
+	for i := range instances {
+		sorted[i] = &instances[i]
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	count := (total*int(percentage) + 99) / 100
+	if count < 1 {
+		count = 1
+	}
+	if step := total - int(maxUnavailable); count > step && step > 0 {
+		count = step
+	}
+	return sorted[:count]
+}
+
+// instanceNames extracts the names to persist in WaveRecord.Members.
+func instanceNames(instances []*appv1beta1.OdooInstance) []string {
+	names := make([]string, len(instances))
+	for i, instance := range instances {
+		names[i] = instance.Name
+	}
+	return names
+}
+
+// membersByName resolves the instance names pinned at wave start back to
+// live objects from the latest List(), instead of re-deriving membership
+// from scratch on every reconcile.
+func membersByName(instances []appv1beta1.OdooInstance, names []string) []*appv1beta1.OdooInstance {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	members := make([]*appv1beta1.OdooInstance, 0, len(names))
+	for i := range instances {
+		if wanted[instances[i].Name] {
+			members = append(members, &instances[i])
+		}
+	}
+	return members
 }
 
 func (r *DeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&appv1beta1.Deployment{}).
+		Watches(&source.Kind{Type: &appv1beta1.OdooInstance{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.deploymentsForInstance),
+		}).
+		Watches(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.deploymentsForJob),
+		}).
 		Complete(r)
 }
+
+// deploymentsForInstance maps an OdooInstance event back to the Deployment(s)
+// that listed it as a target, so a wave's health is re-evaluated as soon as
+// an instance's status changes rather than on the next poll tick.
+func (r *DeploymentReconciler) deploymentsForInstance(o handler.MapObject) []ctrl.Request {
+	instance, ok := o.Object.(*appv1beta1.OdooInstance)
+	if !ok {
+		return nil
+	}
+	deployments := &appv1beta1.DeploymentList{}
+	if err := r.List(context.Background(), deployments, client.InNamespace(instance.Namespace)); err != nil {
+		r.Log.Error(err, "unable to list deployments for instance", "instance", instance.Name)
+		return nil
+	}
+	return requestsForTargets(deployments, instance.Name, instance.Labels)
+}
+
+// deploymentsForJob maps a Job event (copier/migration Jobs) back to the
+// Deployment(s) whose wave is waiting on the instance that owns the Job.
+func (r *DeploymentReconciler) deploymentsForJob(o handler.MapObject) []ctrl.Request {
+	job, ok := o.Object.(*batchv1.Job)
+	if !ok {
+		return nil
+	}
+	instanceName, ok := job.Labels["instance.odoo.io/name"]
+	if !ok {
+		return nil
+	}
+	instance := &appv1beta1.OdooInstance{}
+	if err := r.Get(context.Background(), types.NamespacedName{Namespace: job.Namespace, Name: instanceName}, instance); err != nil {
+		r.Log.Error(err, "unable to get instance for job", "job", job.Name)
+		return nil
+	}
+	deployments := &appv1beta1.DeploymentList{}
+	if err := r.List(context.Background(), deployments, client.InNamespace(job.Namespace)); err != nil {
+		r.Log.Error(err, "unable to list deployments for job", "job", job.Name)
+		return nil
+	}
+	return requestsForTargets(deployments, instanceName, instance.Labels)
+}
+
+// requestsForTargets matches an instance (by name and labels) against each
+// Deployment's Targets the same way listTargetInstances does: a hit on
+// InstanceRefs OR ClusterSelector both requeue, so a ClusterSelector-only
+// Deployment gets the same prompt requeue as one pinned to explicit
+// instance names.
+func requestsForTargets(deployments *appv1beta1.DeploymentList, instanceName string, instanceLabels map[string]string) []ctrl.Request {
+	var requests []ctrl.Request
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		// With no InstanceRefs and no ClusterSelector, listTargetInstances
+		// targets every instance in the namespace.
+		matched := len(d.Spec.Targets.InstanceRefs) == 0 && d.Spec.Targets.ClusterSelector == nil
+		for _, ref := range d.Spec.Targets.InstanceRefs {
+			if ref.Name == instanceName {
+				matched = true
+				break
+			}
+		}
+		if !matched && d.Spec.Targets.ClusterSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(d.Spec.Targets.ClusterSelector)
+			if err == nil && selector.Matches(labels.Set(instanceLabels)) {
+				matched = true
+			}
+		}
+		if matched {
+			requests = append(requests, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: d.Namespace, Name: d.Name}})
+		}
+	}
+	return requests
+}
+
+// metav1Now exists so the handful of call sites above read the same whether
+// the timestamp comes from a fake clock in tests or wall time in production.
+func metav1Now() appv1beta1.Time {
+	return appv1beta1.NowTime()
+}
@@ -0,0 +1,223 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	appv1beta1 "github.com/odoo-operator/app-operator/api/v1beta1"
+)
+
+func TestSelectWaveMembers(t *testing.T) {
+	instances := func(names ...string) []appv1beta1.OdooInstance {
+		out := make([]appv1beta1.OdooInstance, len(names))
+		for i, name := range names {
+			out[i] = appv1beta1.OdooInstance{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		}
+		return out
+	}
+
+	tests := []struct {
+		name           string
+		instances      []appv1beta1.OdooInstance
+		percentage     int32
+		maxUnavailable int32
+		wantNames      []string
+	}{
+		{
+			name:           "rounds up to at least one instance",
+			instances:      instances("c", "a", "b"),
+			percentage:     10,
+			maxUnavailable: 3,
+			wantNames:      []string{"a"},
+		},
+		{
+			name:           "picks the sorted prefix for the given percentage",
+			instances:      instances("d", "b", "c", "a"),
+			percentage:     50,
+			maxUnavailable: 4,
+			wantNames:      []string{"a", "b"},
+		},
+		{
+			name:           "maxUnavailable caps the count even at 100%",
+			instances:      instances("a", "b", "c", "d"),
+			percentage:     100,
+			maxUnavailable: 1,
+			wantNames:      []string{"a", "b", "c"},
+		},
+		{
+			name:           "no instances yields no members",
+			instances:      nil,
+			percentage:     100,
+			maxUnavailable: 0,
+			wantNames:      nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members := selectWaveMembers(tt.instances, tt.percentage, tt.maxUnavailable)
+			got := instanceNames(members)
+			if len(got) != len(tt.wantNames) {
+				t.Fatalf("selectWaveMembers() = %v, want %v", got, tt.wantNames)
+			}
+			for i := range got {
+				if got[i] != tt.wantNames[i] {
+					t.Errorf("selectWaveMembers()[%d] = %q, want %q", i, got[i], tt.wantNames[i])
+				}
+			}
+		})
+	}
+}
+
+// TestReconcileProgressive_RollbackGuardDoesNotBlankReleaseRef exercises the
+// "no previous release to roll back to" branch: a wave that fails analysis
+// on a Deployment's very first rollout must leave the target instance's
+// ReleaseRef alone rather than re-pinning it to the zero value.
+func TestReconcileProgressive_RollbackGuardDoesNotBlankReleaseRef(t *testing.T) {
+	scheme := newTestScheme(t)
+	releaseRef := appv1beta1.ReleaseReference{Name: "odoo-16"}
+
+	instance := &appv1beta1.OdooInstance{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "shop-1"},
+		Spec:       appv1beta1.OdooInstanceSpec{ReleaseRef: releaseRef},
+	}
+	deployment := &appv1beta1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "shop"},
+		Spec: appv1beta1.DeploymentSpec{
+			ReleaseRef:       releaseRef,
+			Waves:            []int32{100},
+			MaxUnavailable:   0,
+			AnalysisInterval: metav1.Duration{Duration: time.Minute},
+			Targets: appv1beta1.DeploymentTargets{
+				InstanceRefs: []appv1beta1.InstanceReference{{Name: "shop-1"}},
+			},
+		},
+		Status: appv1beta1.DeploymentStatus{
+			CurrentWave: 0,
+			WaveHistory: []appv1beta1.WaveRecord{{
+				Wave:       0,
+				Percentage: 100,
+				StartTime:  appv1beta1.Time{Time: time.Now().Add(-time.Hour)},
+				Members:    []string{"shop-1"},
+			}},
+			// PreviousReleaseRef intentionally left zero: this is the
+			// Deployment's first wave, so there is nothing to roll back to.
+		},
+	}
+
+	r := &DeploymentReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, deployment, instance),
+		Log:    ctrl.Log.WithName("test"),
+	}
+
+	if _, err := r.reconcileProgressive(context.Background(), r.Log, deployment); err != nil {
+		t.Fatalf("reconcileProgressive returned error: %v", err)
+	}
+
+	gotInstance := &appv1beta1.OdooInstance{}
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "shop-1"}, gotInstance); err != nil {
+		t.Fatalf("fetching instance: %v", err)
+	}
+	if gotInstance.Spec.ReleaseRef != releaseRef {
+		t.Errorf("instance ReleaseRef = %+v, want it left at %+v instead of blanked", gotInstance.Spec.ReleaseRef, releaseRef)
+	}
+
+	if deployment.Status.FailedReleaseRef != releaseRef {
+		t.Errorf("FailedReleaseRef = %+v, want %+v so this Release isn't retried on the next resync", deployment.Status.FailedReleaseRef, releaseRef)
+	}
+	if deployment.Status.CurrentWave != 0 {
+		t.Errorf("CurrentWave = %d, want reset to 0 after rollback", deployment.Status.CurrentWave)
+	}
+}
+
+// TestPollWaveHealth_IgnoresSnapshotAndStaleFailedJobs guards against two
+// ways an unrelated Job can poison wave analysis: a failed snapshot/backup
+// Job sharing the instance.odoo.io/name label, and a failed copier Job left
+// over (by design) from before this wave even started.
+func TestPollWaveHealth_IgnoresSnapshotAndStaleFailedJobs(t *testing.T) {
+	scheme := newTestScheme(t)
+	releaseRef := appv1beta1.ReleaseReference{Name: "odoo-16"}
+	waveStart := time.Now().Add(-time.Hour)
+
+	instance := &appv1beta1.OdooInstance{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "shop-1"},
+		Spec:       appv1beta1.OdooInstanceSpec{ReleaseRef: releaseRef},
+	}
+	staleCopierJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "copier-stale",
+			Labels:            map[string]string{"instance.odoo.io/name": "shop-1"},
+			CreationTimestamp: metav1.NewTime(waveStart.Add(-24 * time.Hour)),
+		},
+		Status: batchv1.JobStatus{Failed: 1},
+	}
+	failedSnapshotJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "snapshot-nightly",
+			Labels: map[string]string{
+				"instance.odoo.io/name": "shop-1",
+				"app.odoo.io/component": "snapshot",
+			},
+			CreationTimestamp: metav1.NewTime(waveStart.Add(time.Minute)),
+		},
+		Status: batchv1.JobStatus{Failed: 1},
+	}
+
+	r := &DeploymentReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, staleCopierJob, failedSnapshotJob),
+		Log:    ctrl.Log.WithName("test"),
+	}
+
+	_, anyFailed, err := r.pollWaveHealth(context.Background(), []*appv1beta1.OdooInstance{instance}, releaseRef, waveStart)
+	if err != nil {
+		t.Fatalf("pollWaveHealth returned error: %v", err)
+	}
+	if anyFailed {
+		t.Errorf("anyFailed = true, want the stale copier Job and the snapshot Job both ignored")
+	}
+
+	freshMigrationJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "copier-fresh",
+			Labels:            map[string]string{"instance.odoo.io/name": "shop-1"},
+			CreationTimestamp: metav1.NewTime(waveStart.Add(time.Minute)),
+		},
+		Status: batchv1.JobStatus{Failed: 1},
+	}
+	if err := r.Create(context.Background(), freshMigrationJob); err != nil {
+		t.Fatalf("creating fresh migration job: %v", err)
+	}
+
+	_, anyFailed, err = r.pollWaveHealth(context.Background(), []*appv1beta1.OdooInstance{instance}, releaseRef, waveStart)
+	if err != nil {
+		t.Fatalf("pollWaveHealth returned error: %v", err)
+	}
+	if !anyFailed {
+		t.Errorf("anyFailed = false, want a genuinely failed migration Job from this wave to still gate promotion")
+	}
+}
@@ -17,34 +17,207 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	appv1beta1 "github.com/odoo-operator/app-operator/api/v1beta1"
+	"github.com/odoo-operator/app-operator/pkg/registry"
+	"github.com/odoo-operator/app-operator/pkg/sigstore"
 )
 
+const releaseFinalizer = "release.app.odoo.io/in-use"
+
 // ReleaseReconciler reconciles a Release object
 type ReleaseReconciler struct {
 	client.Client
 	Log logr.Logger
+
+	// Resolver talks to the image registry to turn a tag into an immutable
+	// digest and to fetch the module manifest OCI artifact. It is an
+	// interface so tests can substitute a fake registry.
+	Resolver registry.Resolver
+
+	// Verifier checks a cosign/Sigstore signature against a resolved
+	// digest. It is an interface for the same reason as Resolver.
+	Verifier sigstore.Verifier
 }
 
 // +kubebuilder:rbac:groups=app.odoo.io,resources=releases,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=app.odoo.io,resources=releases/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=app.odoo.io,resources=deployments,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list;watch
 
 func (r *ReleaseReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	_ = context.Background()
-	_ = r.Log.WithValues("release", req.NamespacedName)
+	ctx := context.Background()
+	log := r.Log.WithValues("release", req.NamespacedName)
+
+	release := &appv1beta1.Release{}
+	if err := r.Get(ctx, req.NamespacedName, release); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	if !release.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, log, release)
+	}
+
+	if !controllerutilContainsString(release.Finalizers, releaseFinalizer) {
+		release.Finalizers = append(release.Finalizers, releaseFinalizer)
+		if err := r.Update(ctx, release); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	digest, err := r.Resolver.ResolveDigest(ctx, release.Spec.Image)
+	if err != nil {
+		log.Error(err, "unable to resolve image digest", "image", release.Spec.Image)
+		release.SetStatusConditionFailed("DigestResolutionFailed", err.Error())
+		return ctrl.Result{}, r.Status().Update(ctx, release)
+	}
+
+	if release.Spec.Verification != nil && release.Spec.Verification.PublicKeyRef != nil {
+		key, err := r.loadPublicKey(ctx, release.Namespace, release.Spec.Verification.PublicKeyRef)
+		if err != nil {
+			log.Error(err, "unable to load verification public key")
+			release.SetStatusConditionFailed("PublicKeyUnavailable", err.Error())
+			return ctrl.Result{}, r.Status().Update(ctx, release)
+		}
+		if err := r.Verifier.Verify(ctx, digest, key); err != nil {
+			log.Error(err, "signature verification failed", "digest", digest)
+			release.SetStatusConditionFailed("SignatureVerificationFailed", err.Error())
+			return ctrl.Result{}, r.Status().Update(ctx, release)
+		}
+	}
+
+	modules, err := r.Resolver.FetchModuleManifest(ctx, release.Namespace, digest, release.Spec.Modules)
+	if err != nil {
+		log.Error(err, "unable to fetch module manifest", "digest", digest)
+		release.SetStatusConditionFailed("ManifestUnavailable", err.Error())
+		return ctrl.Result{}, r.Status().Update(ctx, release)
+	}
+
+	release.Status.ResolvedDigest = digest
+	release.Status.Modules = modules
+	release.SetStatusConditionReady()
+	log.Info("release resolved", "digest", digest, "modules", len(modules))
+	return ctrl.Result{}, r.Status().Update(ctx, release)
+}
+
+// reconcileDelete blocks deletion of a Release that is still referenced by a
+// Deployment, mirroring the way PVCs block on pod references: the Release is
+// the immutable descriptor a rollout was built on, so deleting it out from
+// under a live Deployment would make rollback impossible.
+func (r *ReleaseReconciler) reconcileDelete(ctx context.Context, log logr.Logger, release *appv1beta1.Release) (ctrl.Result, error) {
+	if !controllerutilContainsString(release.Finalizers, releaseFinalizer) {
+		return ctrl.Result{}, nil
+	}
 
-	// your logic here
+	deployments := &appv1beta1.DeploymentList{}
+	if err := r.List(ctx, deployments, client.InNamespace(release.Namespace)); err != nil {
+		return ctrl.Result{}, err
+	}
+	for i := range deployments.Items {
+		d := &deployments.Items[i]
+		if d.Spec.ReleaseRef.Name == release.Name || d.Status.PreviousReleaseRef.Name == release.Name {
+			log.Info("release still referenced, deferring deletion", "deployment", d.Name)
+			return ctrl.Result{}, nil
+		}
+	}
 
-	return ctrl.Result{}, nil
+	release.Finalizers = controllerutilRemoveString(release.Finalizers, releaseFinalizer)
+	return ctrl.Result{}, r.Update(ctx, release)
+}
+
+// loadPublicKey resolves a PublicKeyRef (Secret or ConfigMap, keyed the same
+// way EnvVarSource.SecretKeyRef/ConfigMapKeyRef are) to the raw key material
+// cosign expects.
+func (r *ReleaseReconciler) loadPublicKey(ctx context.Context, namespace string, ref *appv1beta1.PublicKeyReference) ([]byte, error) {
+	if ref.SecretKeyRef != nil {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.SecretKeyRef.Name}, secret); err != nil {
+			return nil, err
+		}
+		data, ok := secret.Data[ref.SecretKeyRef.Key]
+		if !ok {
+			return nil, fmt.Errorf("key %q not found in secret %q", ref.SecretKeyRef.Key, ref.SecretKeyRef.Name)
+		}
+		return data, nil
+	}
+	if ref.ConfigMapKeyRef != nil {
+		cm := &corev1.ConfigMap{}
+		if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.ConfigMapKeyRef.Name}, cm); err != nil {
+			return nil, err
+		}
+		data, ok := cm.Data[ref.ConfigMapKeyRef.Key]
+		if !ok {
+			return nil, fmt.Errorf("key %q not found in configmap %q", ref.ConfigMapKeyRef.Key, ref.ConfigMapKeyRef.Name)
+		}
+		return []byte(data), nil
+	}
+	return nil, fmt.Errorf("publicKeyRef set but neither secretKeyRef nor configMapKeyRef is populated")
 }
 
 func (r *ReleaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&appv1beta1.Release{}).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.releasesForVerificationSource),
+		}).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: handler.ToRequestsFunc(r.releasesForVerificationSource),
+		}).
 		Complete(r)
 }
+
+// releasesForVerificationSource re-triggers verification for any Release
+// whose Spec.Verification.PublicKeyRef points at the Secret/ConfigMap that
+// just changed, so a rotated key is picked up without waiting for the next
+// unrelated reconcile.
+func (r *ReleaseReconciler) releasesForVerificationSource(o handler.MapObject) []ctrl.Request {
+	releases := &appv1beta1.ReleaseList{}
+	if err := r.List(context.Background(), releases, client.InNamespace(o.Meta.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list releases for verification source", "source", o.Meta.GetName())
+		return nil
+	}
+	var requests []ctrl.Request
+	for i := range releases.Items {
+		rel := &releases.Items[i]
+		if rel.Spec.Verification == nil || rel.Spec.Verification.PublicKeyRef == nil {
+			continue
+		}
+		ref := rel.Spec.Verification.PublicKeyRef
+		if (ref.SecretKeyRef != nil && ref.SecretKeyRef.Name == o.Meta.GetName()) ||
+			(ref.ConfigMapKeyRef != nil && ref.ConfigMapKeyRef.Name == o.Meta.GetName()) {
+			requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKey{Namespace: rel.Namespace, Name: rel.Name}})
+		}
+	}
+	return requests
+}
+
+func controllerutilContainsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func controllerutilRemoveString(slice []string, s string) []string {
+	out := make([]string, 0, len(slice))
+	for _, item := range slice {
+		if item != s {
+			out = append(out, item)
+		}
+	}
+	return out
+}
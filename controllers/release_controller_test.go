@@ -0,0 +1,205 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	appv1beta1 "github.com/odoo-operator/app-operator/api/v1beta1"
+	"github.com/odoo-operator/app-operator/pkg/registry"
+)
+
+// fakeResolver is a registry.Resolver a test can script without hitting a
+// real registry, exercising the reason the field is declared as an
+// interface in the first place.
+type fakeResolver struct {
+	digest  string
+	err     error
+	modules []registry.Module
+}
+
+func (f *fakeResolver) ResolveDigest(ctx context.Context, image string) (string, error) {
+	return f.digest, f.err
+}
+
+func (f *fakeResolver) FetchModuleManifest(ctx context.Context, namespace, digest string, modules *registry.ModuleSource) ([]registry.Module, error) {
+	return f.modules, nil
+}
+
+// fakeVerifier is a sigstore.Verifier a test can script to return a
+// signature failure without touching a real cosign signature image.
+type fakeVerifier struct {
+	err error
+}
+
+func (f *fakeVerifier) Verify(ctx context.Context, digest string, publicKeyPEM []byte) error {
+	return f.err
+}
+
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatalf("adding client-go scheme: %v", err)
+	}
+	if err := appv1beta1.AddToScheme(scheme); err != nil {
+		t.Fatalf("adding appv1beta1 scheme: %v", err)
+	}
+	return scheme
+}
+
+func TestReleaseReconcile_ResolvesDigestAndFetchesModules(t *testing.T) {
+	release := &appv1beta1.Release{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "odoo-16"},
+		Spec:       appv1beta1.ReleaseSpec{Image: "registry.example.com/odoo:16.0"},
+	}
+	scheme := newTestScheme(t)
+	r := &ReleaseReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, release),
+		Log:    ctrl.Log.WithName("test"),
+		Resolver: &fakeResolver{
+			digest:  "registry.example.com/odoo@sha256:deadbeef",
+			modules: []registry.Module{{Name: "sale", Version: "16.0.1.0.0"}},
+		},
+		Verifier: &fakeVerifier{},
+	}
+
+	if _, err := r.Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "default", Name: "odoo-16"}}); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+
+	got := &appv1beta1.Release{}
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "odoo-16"}, got); err != nil {
+		t.Fatalf("fetching reconciled release: %v", err)
+	}
+	if got.Status.ResolvedDigest != "registry.example.com/odoo@sha256:deadbeef" {
+		t.Errorf("ResolvedDigest = %q, want the resolver's digest", got.Status.ResolvedDigest)
+	}
+	if len(got.Status.Modules) != 1 || got.Status.Modules[0].Name != "sale" {
+		t.Errorf("Status.Modules = %+v, want the resolver's manifest", got.Status.Modules)
+	}
+	if !controllerutilContainsString(got.Finalizers, releaseFinalizer) {
+		t.Errorf("Finalizers = %v, want %q added", got.Finalizers, releaseFinalizer)
+	}
+}
+
+func TestReleaseReconcile_SignatureVerificationFailureLeavesDigestUnset(t *testing.T) {
+	release := &appv1beta1.Release{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "odoo-16"},
+		Spec: appv1beta1.ReleaseSpec{
+			Image: "registry.example.com/odoo:16.0",
+			Verification: &appv1beta1.ReleaseVerification{
+				PublicKeyRef: &appv1beta1.PublicKeyReference{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "cosign-key"},
+						Key:                  "cosign.pub",
+					},
+				},
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cosign-key"},
+		Data:       map[string][]byte{"cosign.pub": []byte("not-a-real-key")},
+	}
+	scheme := newTestScheme(t)
+	r := &ReleaseReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, release, secret),
+		Log:    ctrl.Log.WithName("test"),
+		Resolver: &fakeResolver{
+			digest: "registry.example.com/odoo@sha256:deadbeef",
+		},
+		Verifier: &fakeVerifier{err: errors.New("signature does not match key")},
+	}
+
+	if _, err := r.Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "default", Name: "odoo-16"}}); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+
+	got := &appv1beta1.Release{}
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "odoo-16"}, got); err != nil {
+		t.Fatalf("fetching reconciled release: %v", err)
+	}
+	if got.Status.ResolvedDigest != "" {
+		t.Errorf("ResolvedDigest = %q, want unset when signature verification fails", got.Status.ResolvedDigest)
+	}
+}
+
+func TestReleaseReconcileDelete_BlockedWhileReferencedByDeployment(t *testing.T) {
+	release := &appv1beta1.Release{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "odoo-16", Finalizers: []string{releaseFinalizer}},
+	}
+	deployment := &appv1beta1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "shop"},
+		Spec:       appv1beta1.DeploymentSpec{ReleaseRef: appv1beta1.ReleaseReference{Name: "odoo-16"}},
+	}
+	scheme := newTestScheme(t)
+	r := &ReleaseReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, release, deployment),
+		Log:    ctrl.Log.WithName("test"),
+	}
+
+	if _, err := r.reconcileDelete(context.Background(), r.Log, release); err != nil {
+		t.Fatalf("reconcileDelete returned error: %v", err)
+	}
+
+	got := &appv1beta1.Release{}
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "odoo-16"}, got); err != nil {
+		t.Fatalf("fetching release: %v", err)
+	}
+	if !controllerutilContainsString(got.Finalizers, releaseFinalizer) {
+		t.Errorf("Finalizers = %v, want %q kept while a Deployment still references this Release", got.Finalizers, releaseFinalizer)
+	}
+}
+
+func TestReleaseReconcileDelete_RemovesFinalizerWhenUnreferenced(t *testing.T) {
+	release := &appv1beta1.Release{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "odoo-16", Finalizers: []string{releaseFinalizer}},
+	}
+	// A Deployment exists in the same namespace but points at a different
+	// Release, so it must not hold this one's finalizer.
+	deployment := &appv1beta1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "shop"},
+		Spec:       appv1beta1.DeploymentSpec{ReleaseRef: appv1beta1.ReleaseReference{Name: "odoo-17"}},
+	}
+	scheme := newTestScheme(t)
+	r := &ReleaseReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, release, deployment),
+		Log:    ctrl.Log.WithName("test"),
+	}
+
+	if _, err := r.reconcileDelete(context.Background(), r.Log, release); err != nil {
+		t.Fatalf("reconcileDelete returned error: %v", err)
+	}
+
+	got := &appv1beta1.Release{}
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "odoo-16"}, got); err != nil {
+		t.Fatalf("fetching release: %v", err)
+	}
+	if controllerutilContainsString(got.Finalizers, releaseFinalizer) {
+		t.Errorf("Finalizers = %v, want %q removed once no Deployment references this Release", got.Finalizers, releaseFinalizer)
+	}
+}
@@ -31,7 +31,11 @@
 package components
 
 import (
+	"crypto/sha256"
 	e "errors"
+	"fmt"
+	"sync"
+
 	"github.com/golang/glog"
 
 	"github.com/blaggacao/ridecell-operator/pkg/components"
@@ -40,6 +44,9 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -48,12 +55,54 @@ import (
 	instancev1beta1 "github.com/xoe-labs/odoo-operator/pkg/apis/instance/v1beta1"
 )
 
+// copierWorkerCount mirrors the small, fixed worker pool size used by
+// client-go's sample-controller: there is no benefit to more workers than
+// the queue can usefully keep busy, and it bounds how many copier Jobs we
+// ever create concurrently.
+const copierWorkerCount = 2
+
 type copierComponent struct {
 	templatePath string
+
+	// elected is closed once this manager replica has won leader election.
+	// Only the leader creates copier Jobs; see isElected.
+	elected <-chan struct{}
+
+	// queue serializes work per "namespace/name" OdooInstance key so that
+	// two overlapping reconciles of the same instance (a resync racing a
+	// watch event, for example) can never both observe a missing Job and
+	// both try to create it. Rate limiting gives transient registry/API
+	// errors exponential backoff instead of a hot retry loop.
+	queue workqueue.RateLimitingInterface
+
+	// pending holds the most recent ComponentContext seen for each key, so
+	// the worker that eventually drains the key has what it needs (the
+	// typed instance, the live client, the template renderer) without the
+	// queue itself having to carry non-comparable payloads.
+	mu      sync.Mutex
+	pending map[string]*components.ComponentContext
 }
 
-func NewCopier(templatePath string) *copierComponent {
-	return &copierComponent{templatePath: templatePath}
+func NewCopier(mgr ctrl.Manager, elected <-chan struct{}, templatePath string) *copierComponent {
+	comp := &copierComponent{
+		templatePath: templatePath,
+		elected:      elected,
+		queue:        workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "copier"),
+		pending:      map[string]*components.ComponentContext{},
+	}
+
+	informer, err := mgr.GetCache().GetInformer(&instancev1beta1.OdooInstance{})
+	if err != nil {
+		glog.Fatalf("copier: unable to get OdooInstance informer: %v", err)
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: comp.OnInstanceDeleted,
+	})
+
+	for i := 0; i < copierWorkerCount; i++ {
+		go comp.runWorker()
+	}
+	return comp
 }
 
 // +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
@@ -61,6 +110,7 @@ func NewCopier(templatePath string) *copierComponent {
 func (_ *copierComponent) WatchTypes() []runtime.Object {
 	return []runtime.Object{
 		&batchv1.Job{},
+		&instancev1beta1.OdooInstance{},
 	}
 }
 
@@ -77,7 +127,98 @@ func (_ *copierComponent) IsReconcilable(ctx *components.ComponentContext) bool
 	return true
 }
 
+// Reconcile no longer touches the API server itself: it stashes the current
+// ComponentContext and hands the instance's key to the workqueue, so the
+// actual Get-then-Create critical section always runs on exactly one worker
+// goroutine at a time for a given instance, however many overlapping
+// Reconcile calls the outer engine makes.
 func (comp *copierComponent) Reconcile(ctx *components.ComponentContext) (reconcile.Result, error) {
+	if !isElected(comp.elected) {
+		// Only the leader creates copier Jobs; non-leader replicas still
+		// watch and cache so they can take over instantly on failover.
+		return reconcile.Result{}, nil
+	}
+
+	instance := ctx.Top.(*instancev1beta1.OdooInstance)
+	key := instance.Namespace + "/" + instance.Name
+
+	comp.mu.Lock()
+	comp.pending[key] = ctx
+	comp.mu.Unlock()
+
+	comp.queue.Add(key)
+	return reconcile.Result{}, nil
+}
+
+// OnInstanceDeleted is wired up as the informer's DeleteFunc for
+// instancev1beta1.OdooInstance so that deleting a parent (or the child
+// itself) while a copier Job is in flight can't leave a stale pending
+// ComponentContext or rate-limiter backoff behind: the deleted instance's own
+// entry goes, and so does that of every pending child whose parent lookup
+// (see syncHandler) matches it. A key already in the queue is then drained as
+// a no-op by syncHandler.
+func (comp *copierComponent) OnInstanceDeleted(obj interface{}) {
+	instance, ok := obj.(*instancev1beta1.OdooInstance)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			glog.Errorf("copier: tombstone contained unexpected object, expected OdooInstance")
+			return
+		}
+		instance, ok = tombstone.Obj.(*instancev1beta1.OdooInstance)
+		if !ok {
+			glog.Errorf("copier: tombstone contained unexpected object, expected OdooInstance")
+			return
+		}
+	}
+
+	key := instance.Namespace + "/" + instance.Name
+	comp.mu.Lock()
+	delete(comp.pending, key)
+	comp.queue.Forget(key)
+	for childKey, childCtx := range comp.pending {
+		child := childCtx.Top.(*instancev1beta1.OdooInstance)
+		if child.Namespace == instance.Namespace && child.Spec.ParentHostname != nil &&
+			*child.Spec.ParentHostname == instance.Labels["instance.odoo.io/hostname"] &&
+			child.Labels["cluster.odoo.io/name"] == instance.Labels["cluster.odoo.io/name"] {
+			delete(comp.pending, childKey)
+			comp.queue.Forget(childKey)
+		}
+	}
+	comp.mu.Unlock()
+}
+
+func (comp *copierComponent) runWorker() {
+	for comp.processNextWorkItem() {
+	}
+}
+
+func (comp *copierComponent) processNextWorkItem() bool {
+	key, shutdown := comp.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer comp.queue.Done(key)
+
+	err := comp.syncHandler(key.(string))
+	if err != nil {
+		glog.Errorf("copier: error syncing %q, requeueing: %v", key, err)
+		comp.queue.AddRateLimited(key)
+		return true
+	}
+	comp.queue.Forget(key)
+	return true
+}
+
+func (comp *copierComponent) syncHandler(key string) error {
+	comp.mu.Lock()
+	ctx, ok := comp.pending[key]
+	comp.mu.Unlock()
+	if !ok {
+		// The instance was deleted (or superseded) before we got to it.
+		return nil
+	}
+
 	instance := ctx.Top.(*instancev1beta1.OdooInstance)
 	parentinstances := &instancev1beta1.OdooInstanceList{}
 
@@ -89,13 +230,18 @@ func (comp *copierComponent) Reconcile(ctx *components.ComponentContext) (reconc
 	})
 	err := ctx.List(ctx.Context, listoptions, parentinstances)
 	if err != nil {
-		return reconcile.Result{}, err
+		return err
 	}
 	if len(parentinstances.Items) > 1 {
-		return reconcile.Result{}, e.New("more than one parent instance found")
+		return e.New("more than one parent instance found")
 	} else if len(parentinstances.Items) < 1 {
 		glog.Infof("[%s/%s] copier: Did not find parent OdooInstance with hostname %s\n", instance.Namespace, instance.Name, *instance.Spec.ParentHostname)
-		return reconcile.Result{Requeue: true}, e.New("No parent instance found")
+		// Return an error instead of requeueing ourselves here: the caller
+		// (processNextWorkItem) owns the single AddRateLimited/Forget
+		// decision for this key, so a transient "no parent yet" gets the
+		// same exponential backoff as any other sync error instead of a
+		// Forget immediately wiping out the backoff we just requested.
+		return fmt.Errorf("no parent OdooInstance found with hostname %s", *instance.Spec.ParentHostname)
 	}
 
 	extra := map[string]interface{}{}
@@ -103,9 +249,10 @@ func (comp *copierComponent) Reconcile(ctx *components.ComponentContext) (reconc
 
 	obj, err := ctx.GetTemplate(comp.templatePath, extra)
 	if err != nil {
-		return reconcile.Result{}, err
+		return err
 	}
 	job := obj.(*batchv1.Job)
+	job.Name = copierJobName(instance, &parentinstances.Items[0])
 
 	existing := &batchv1.Job{}
 	err = ctx.Get(ctx.Context, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, existing)
@@ -113,22 +260,25 @@ func (comp *copierComponent) Reconcile(ctx *components.ComponentContext) (reconc
 		glog.Infof("[%s/%s] copier: Creating copier Job %s/%s\n", instance.Namespace, instance.Name, job.Namespace, job.Name)
 
 		instance.SetStatusConditionCopyJobCreationCreated()
+		if err := ctx.Status().Update(ctx.Context, instance); err != nil {
+			return err
+		}
 
-		// Launching the job
-		err = controllerutil.SetControllerReference(instance, job, ctx.Scheme)
-		if err != nil {
-			return reconcile.Result{}, err
+		if err := controllerutil.SetControllerReference(instance, job, ctx.Scheme); err != nil {
+			return err
 		}
-		err = ctx.Create(ctx.Context, job)
-		if err != nil {
-			// If this fails, someone else might have started a copier job between the Get and here, so just try again.
-			return reconcile.Result{Requeue: true}, err
+		// The Job name is now deterministic per (instance, parent,
+		// generation), so a concurrent create from another replica or an
+		// earlier, not-yet-cached attempt collapses into this one instead
+		// of producing duplicate Jobs; IgnoreAlreadyExists just means we
+		// pick it up on the next sync instead of erroring on the race.
+		if err := client.IgnoreAlreadyExists(ctx.Create(ctx.Context, job)); err != nil {
+			return err
 		}
-		// Job is started, so we're done for now.
-		return reconcile.Result{}, nil
+		return nil
 	} else if err != nil {
 		// Some other real error, bail.
-		return reconcile.Result{}, err
+		return err
 	}
 
 	// If we get this far, the job previously started at some point and might be done.
@@ -139,11 +289,13 @@ func (comp *copierComponent) Reconcile(ctx *components.ComponentContext) (reconc
 		glog.Infof("[%s/%s] copier: Copier Job succeeded, setting OdooInstanceStatusCondition \"Created\" to 'true'\n", instance.Namespace, instance.Name)
 
 		instance.SetStatusConditionCopyJobSuccessCreated()
+		if err := ctx.Status().Update(ctx.Context, instance); err != nil {
+			return err
+		}
 
 		glog.V(2).Infof("[%s/%s] copier: Deleting copier Job %s/%s\n", instance.Namespace, instance.Name, existing.Namespace, existing.Name)
-		err = ctx.Delete(ctx.Context, existing, client.PropagationPolicy(metav1.DeletePropagationBackground))
-		if err != nil {
-			return reconcile.Result{Requeue: true}, err
+		if err := ctx.Delete(ctx.Context, existing, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+			return err
 		}
 	}
 
@@ -153,5 +305,17 @@ func (comp *copierComponent) Reconcile(ctx *components.ComponentContext) (reconc
 	}
 
 	// Job is still running, will get reconciled when it finishes.
-	return reconcile.Result{}, nil
+	return nil
+}
+
+// copierJobName derives a stable Job name from the instance's identity, the
+// parent it is copying from, and the instance's Generation, so retries and
+// concurrent reconciles of the same logical copy always address the same
+// Job instead of racing to create look-alikes. Generation (bumped by the API
+// server on every spec write, including a ReleaseRef pin) is what makes this
+// re-trigger a fresh copy when the instance is re-pointed at a new parent or
+// Release, rather than wedging on a stale Job name forever.
+func copierJobName(instance, parent *instancev1beta1.OdooInstance) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%d", instance.UID, parent.Spec.Hostname, instance.Generation)))
+	return fmt.Sprintf("copier-%x", h[:8])
 }
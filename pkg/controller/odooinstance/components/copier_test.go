@@ -0,0 +1,136 @@
+/*
+ * This file is part of the Odoo-Operator (R) project.
+ * Copyright (c) 2018-2018 XOE Corp. SAS
+ * Authors: David Arnold, et al.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ *
+ * ALTERNATIVE LICENCING OPTION
+ *
+ * You can be released from the requirements of the license by purchasing
+ * a commercial license. Buying such a license is mandatory as soon as you
+ * develop commercial activities involving the Odoo-Operator software without
+ * disclosing the source code of your own applications. These activities
+ * include: Offering paid services to a customer as an ASP, shipping Odoo-
+ * Operator with a closed source product.
+ *
+ */
+
+package components
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/blaggacao/ridecell-operator/pkg/components"
+	instancev1beta1 "github.com/xoe-labs/odoo-operator/pkg/apis/instance/v1beta1"
+)
+
+func newCopierTestScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := instancev1beta1.AddToScheme(scheme); err != nil {
+		t.Fatalf("adding instancev1beta1 scheme: %v", err)
+	}
+	return scheme
+}
+
+func newCopierTestInstance(name string) *instancev1beta1.OdooInstance {
+	parentHostname := "parent.example.com"
+	return &instancev1beta1.OdooInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			Labels:    map[string]string{"cluster.odoo.io/name": "demo"},
+		},
+		Spec: instancev1beta1.OdooInstanceSpec{ParentHostname: &parentHostname},
+	}
+}
+
+func closedElectedChan() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+func newTestCopierComponent() *copierComponent {
+	return &copierComponent{
+		elected: closedElectedChan(),
+		queue:   workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "copier-test"),
+		pending: map[string]*components.ComponentContext{},
+	}
+}
+
+// TestCopierReconcile_ConcurrentCallsCollapseToOneQueueEntry exercises the
+// fix this request was about: two overlapping Reconcile() calls for the
+// same instance must not enqueue two separate syncs (which would race each
+// other's Get-then-Create), and the worker that eventually drains the key
+// must see the most recent ComponentContext, not a stale one.
+func TestCopierReconcile_ConcurrentCallsCollapseToOneQueueEntry(t *testing.T) {
+	scheme := newCopierTestScheme(t)
+	instance := newCopierTestInstance("shop-1")
+	comp := newTestCopierComponent()
+
+	ctx1 := &components.ComponentContext{Context: context.Background(), Client: fake.NewFakeClientWithScheme(scheme), Top: instance, Scheme: scheme}
+	ctx2 := &components.ComponentContext{Context: context.Background(), Client: fake.NewFakeClientWithScheme(scheme), Top: instance, Scheme: scheme}
+
+	if _, err := comp.Reconcile(ctx1); err != nil {
+		t.Fatalf("first Reconcile returned error: %v", err)
+	}
+	if _, err := comp.Reconcile(ctx2); err != nil {
+		t.Fatalf("second Reconcile returned error: %v", err)
+	}
+
+	if got := comp.queue.Len(); got != 1 {
+		t.Errorf("queue.Len() = %d, want 1: two Reconciles of the same instance should collapse to a single pending sync", got)
+	}
+
+	key := instance.Namespace + "/" + instance.Name
+	comp.mu.Lock()
+	got := comp.pending[key]
+	comp.mu.Unlock()
+	if got != ctx2 {
+		t.Errorf("pending[%q] did not retain the most recent ComponentContext", key)
+	}
+}
+
+// TestCopierProcessNextWorkItem_RequeuesSyncErrorInsteadOfDropping drives the
+// queue directly through a sync failure (no parent OdooInstance present, so
+// syncHandler fails before ever reaching the template/Job-creation path) and
+// checks the failure goes through AddRateLimited, not a silent Forget.
+func TestCopierProcessNextWorkItem_RequeuesSyncErrorInsteadOfDropping(t *testing.T) {
+	scheme := newCopierTestScheme(t)
+	instance := newCopierTestInstance("shop-1")
+	comp := newTestCopierComponent()
+
+	ctx := &components.ComponentContext{Context: context.Background(), Client: fake.NewFakeClientWithScheme(scheme), Top: instance, Scheme: scheme}
+	if _, err := comp.Reconcile(ctx); err != nil {
+		t.Fatalf("Reconcile returned error: %v", err)
+	}
+
+	if again := comp.processNextWorkItem(); !again {
+		t.Fatalf("processNextWorkItem() = false, want true so the worker keeps running after a sync error")
+	}
+
+	key := instance.Namespace + "/" + instance.Name
+	if n := comp.queue.NumRequeues(key); n != 1 {
+		t.Errorf("NumRequeues(%q) = %d, want 1: a failed sync must go through the normal backoff path, not be dropped", key, n)
+	}
+}
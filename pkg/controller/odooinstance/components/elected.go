@@ -0,0 +1,45 @@
+/*
+ * This file is part of the Odoo-Operator (R) project.
+ * Copyright (c) 2018-2018 XOE Corp. SAS
+ * Authors: David Arnold, et al.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ *
+ * ALTERNATIVE LICENCING OPTION
+ *
+ * You can be released from the requirements of the license by purchasing
+ * a commercial license. Buying such a license is mandatory as soon as you
+ * develop commercial activities involving the Odoo-Operator software without
+ * disclosing the source code of your own applications. These activities
+ * include: Offering paid services to a customer as an ASP, shipping Odoo-
+ * Operator with a closed source product.
+ *
+ */
+
+package components
+
+// isElected reports whether elected (a manager's mgr.Elected() channel) has
+// been closed, i.e. this replica has won leader election. It never blocks:
+// an open channel just means "not the leader (yet)". Components that
+// create or mutate cluster state check this themselves rather than relying
+// on any leader-election awareness from the upstream component engine.
+func isElected(elected <-chan struct{}) bool {
+	select {
+	case <-elected:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * This file is part of the Odoo-Operator (R) project.
+ * Copyright (c) 2018-2018 XOE Corp. SAS
+ * Authors: David Arnold, et al.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ *
+ * ALTERNATIVE LICENCING OPTION
+ *
+ * You can be released from the requirements of the license by purchasing
+ * a commercial license. Buying such a license is mandatory as soon as you
+ * develop commercial activities involving the Odoo-Operator software without
+ * disclosing the source code of your own applications. These activities
+ * include: Offering paid services to a customer as an ASP, shipping Odoo-
+ * Operator with a closed source product.
+ *
+ */
+
+package components
+
+import (
+	"github.com/golang/glog"
+
+	"github.com/blaggacao/ridecell-operator/pkg/components"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	instancev1beta1 "github.com/xoe-labs/odoo-operator/pkg/apis/instance/v1beta1"
+)
+
+// restoreComponent seeds a new instance's database from a snapshot instead
+// of a live parent, for disaster recovery or standing up a copy once the
+// original parent is gone. Like copierComponent it only runs before the
+// instance is Created, since a restore that ran again afterwards would
+// clobber a database already in use.
+type restoreComponent struct {
+	templatePath string
+
+	// elected is closed once this manager replica has won leader election.
+	// Only the leader creates restore Jobs; see isElected.
+	elected <-chan struct{}
+}
+
+func NewRestore(elected <-chan struct{}, templatePath string) *restoreComponent {
+	return &restoreComponent{templatePath: templatePath, elected: elected}
+}
+
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs/status,verbs=get;update;patch
+func (_ *restoreComponent) WatchTypes() []runtime.Object {
+	return []runtime.Object{
+		&batchv1.Job{},
+	}
+}
+
+func (_ *restoreComponent) IsReconcilable(ctx *components.ComponentContext) bool {
+	instance := ctx.Top.(*instancev1beta1.OdooInstance)
+	if instance.Spec.RestoreFrom == nil {
+		return false
+	}
+	if instance.GetStatusCondition(instancev1beta1.OdooInstanceStatusConditionTypeCreated) != nil {
+		// The instance is already created (or creating); restoring now
+		// would overwrite a live database.
+		return false
+	}
+	return true
+}
+
+func (comp *restoreComponent) Reconcile(ctx *components.ComponentContext) (reconcile.Result, error) {
+	if !isElected(comp.elected) {
+		return reconcile.Result{}, nil
+	}
+
+	instance := ctx.Top.(*instancev1beta1.OdooInstance)
+
+	extra := map[string]interface{}{
+		"SnapshotRef": instance.Spec.RestoreFrom.SnapshotRef,
+	}
+	obj, err := ctx.GetTemplate(comp.templatePath, extra)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	job := obj.(*batchv1.Job)
+
+	existing := &batchv1.Job{}
+	err = ctx.Get(ctx.Context, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, existing)
+	if err != nil && errors.IsNotFound(err) {
+		glog.Infof("[%s/%s] restore: Creating restore Job %s/%s\n", instance.Namespace, instance.Name, job.Namespace, job.Name)
+
+		instance.SetStatusConditionRestoreStarted()
+		if err := ctx.Status().Update(ctx.Context, instance); err != nil {
+			return reconcile.Result{}, err
+		}
+
+		if err := controllerutil.SetControllerReference(instance, job, ctx.Scheme); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, client.IgnoreAlreadyExists(ctx.Create(ctx.Context, job))
+	} else if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if existing.Status.Succeeded > 0 {
+		// Setting Created here (alongside RestoreSucceeded) matters as much
+		// as the condition itself: IsReconcilable only returns false once
+		// Created is set, so without it every later reconcile would find
+		// the (now-deleted) Job missing and create a new restore Job,
+		// clobbering the database it just restored.
+		glog.Infof("[%s/%s] restore: Restore Job succeeded, setting OdooInstanceStatusCondition \"RestoreSucceeded\" and \"Created\" to 'true'\n", instance.Namespace, instance.Name)
+
+		instance.SetStatusConditionRestoreSuccessCreated()
+		if err := ctx.Status().Update(ctx.Context, instance); err != nil {
+			return reconcile.Result{}, err
+		}
+
+		glog.V(2).Infof("[%s/%s] restore: Deleting restore Job %s/%s\n", instance.Namespace, instance.Name, existing.Namespace, existing.Name)
+		return reconcile.Result{}, client.IgnoreNotFound(ctx.Delete(ctx.Context, existing))
+	}
+
+	if existing.Status.Failed > 0 {
+		glog.Errorf("[%s/%s] restore: Restore Job failed, leaving job %s/%s for debugging purposes\n", instance.Namespace, instance.Name, existing.Namespace, existing.Name)
+		instance.SetStatusConditionRestoreFailed()
+		return reconcile.Result{}, ctx.Status().Update(ctx.Context, instance)
+	}
+
+	// Job is still running, will get reconciled when it finishes.
+	return reconcile.Result{}, nil
+}
@@ -0,0 +1,290 @@
+/*
+ * This file is part of the Odoo-Operator (R) project.
+ * Copyright (c) 2018-2018 XOE Corp. SAS
+ * Authors: David Arnold, et al.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ *
+ * ALTERNATIVE LICENCING OPTION
+ *
+ * You can be released from the requirements of the license by purchasing
+ * a commercial license. Buying such a license is mandatory as soon as you
+ * develop commercial activities involving the Odoo-Operator software without
+ * disclosing the source code of your own applications. These activities
+ * include: Offering paid services to a customer as an ASP, shipping Odoo-
+ * Operator with a closed source product.
+ *
+ */
+
+package components
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/golang/glog"
+
+	"github.com/blaggacao/ridecell-operator/pkg/components"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	instancev1beta1 "github.com/xoe-labs/odoo-operator/pkg/apis/instance/v1beta1"
+)
+
+// snapshotComponent takes scheduled or on-demand backups of an instance's
+// database to external storage. It mirrors copierComponent's shape
+// (WatchTypes/IsReconcilable/Reconcile over a template-rendered Job) but,
+// unlike the copier, it keeps running for the lifetime of the instance
+// rather than only before it is first created.
+type snapshotComponent struct {
+	cronJobTemplatePath string
+	jobTemplatePath     string
+
+	// elected is closed once this manager replica has won leader election.
+	// Only the leader creates snapshot CronJobs/Jobs; see isElected.
+	elected <-chan struct{}
+}
+
+func NewSnapshot(elected <-chan struct{}, cronJobTemplatePath, jobTemplatePath string) *snapshotComponent {
+	return &snapshotComponent{
+		cronJobTemplatePath: cronJobTemplatePath,
+		jobTemplatePath:     jobTemplatePath,
+		elected:             elected,
+	}
+}
+
+// +kubebuilder:rbac:groups=batch,resources=cronjobs;jobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs/status,verbs=get;update;patch
+func (_ *snapshotComponent) WatchTypes() []runtime.Object {
+	return []runtime.Object{
+		&batchv1beta1.CronJob{},
+		&batchv1.Job{},
+	}
+}
+
+func (_ *snapshotComponent) IsReconcilable(ctx *components.ComponentContext) bool {
+	instance := ctx.Top.(*instancev1beta1.OdooInstance)
+	return instance.Spec.Snapshot != nil
+}
+
+func (comp *snapshotComponent) Reconcile(ctx *components.ComponentContext) (reconcile.Result, error) {
+	if !isElected(comp.elected) {
+		return reconcile.Result{}, nil
+	}
+
+	instance := ctx.Top.(*instancev1beta1.OdooInstance)
+	snapshot := instance.Spec.Snapshot
+
+	if snapshot.Schedule != "" {
+		if res, err := comp.reconcileCronJob(ctx, instance); err != nil {
+			return res, err
+		}
+	}
+
+	if snapshot.TriggerNow {
+		if res, err := comp.reconcileOneShotJob(ctx, instance); err != nil {
+			return res, err
+		}
+	}
+
+	if err := comp.syncLastSnapshotRef(ctx, instance); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	return reconcile.Result{}, comp.pruneOldSnapshots(ctx, instance)
+}
+
+// reconcileCronJob keeps a CronJob in sync with Spec.Snapshot.Schedule so
+// scheduled snapshots run without the operator itself having to track time.
+func (comp *snapshotComponent) reconcileCronJob(ctx *components.ComponentContext, instance *instancev1beta1.OdooInstance) (reconcile.Result, error) {
+	extra := map[string]interface{}{
+		"Schedule":    instance.Spec.Snapshot.Schedule,
+		"Destination": instance.Spec.Snapshot.Destination,
+	}
+	obj, err := ctx.GetTemplate(comp.cronJobTemplatePath, extra)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	desired := obj.(*batchv1beta1.CronJob)
+
+	existing := &batchv1beta1.CronJob{}
+	err = ctx.Get(ctx.Context, types.NamespacedName{Name: desired.Name, Namespace: desired.Namespace}, existing)
+	if err != nil && errors.IsNotFound(err) {
+		if err := controllerutil.SetControllerReference(instance, desired, ctx.Scheme); err != nil {
+			return reconcile.Result{}, err
+		}
+		glog.Infof("[%s/%s] snapshot: Creating snapshot CronJob %s/%s\n", instance.Namespace, instance.Name, desired.Namespace, desired.Name)
+		return reconcile.Result{}, client.IgnoreAlreadyExists(ctx.Create(ctx.Context, desired))
+	} else if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// Compare more than the schedule string: Destination (and anything else
+	// the template renders into the job's pod spec, e.g. the snapshot
+	// image) lives in the CronJob's JobTemplate, not in a field we can
+	// diff cheaply. Re-rendering and comparing the whole PodSpec means a
+	// Destination change on an existing instance actually reaches the
+	// CronJob instead of being silently dropped.
+	specChanged := existing.Spec.Schedule != desired.Spec.Schedule ||
+		!reflect.DeepEqual(existing.Spec.JobTemplate.Spec.Template.Spec, desired.Spec.JobTemplate.Spec.Template.Spec)
+	if specChanged {
+		existing.Spec.Schedule = desired.Spec.Schedule
+		existing.Spec.JobTemplate.Spec.Template.Spec = desired.Spec.JobTemplate.Spec.Template.Spec
+		glog.Infof("[%s/%s] snapshot: Updating snapshot CronJob %s/%s (schedule=%q)\n", instance.Namespace, instance.Name, existing.Namespace, existing.Name, desired.Spec.Schedule)
+		return reconcile.Result{}, ctx.Update(ctx.Context, existing)
+	}
+	return reconcile.Result{}, nil
+}
+
+// reconcileOneShotJob creates a single snapshot Job when the user asked for
+// one out-of-band (Spec.Snapshot.TriggerNow), independently of the schedule.
+func (comp *snapshotComponent) reconcileOneShotJob(ctx *components.ComponentContext, instance *instancev1beta1.OdooInstance) (reconcile.Result, error) {
+	extra := map[string]interface{}{
+		"Destination": instance.Spec.Snapshot.Destination,
+	}
+	obj, err := ctx.GetTemplate(comp.jobTemplatePath, extra)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	job := obj.(*batchv1.Job)
+	// Name the Job per-trigger (instance identity + TriggerGeneration), the
+	// same way copierJobName collapses racing creates onto one Job: without
+	// this, the name is constant, so a second TriggerNow after the first
+	// Job already succeeded just re-finds that same completed Job and does
+	// nothing.
+	job.Name = oneShotSnapshotJobName(instance)
+
+	existing := &batchv1.Job{}
+	err = ctx.Get(ctx.Context, types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, existing)
+	if err != nil && errors.IsNotFound(err) {
+		if err := controllerutil.SetControllerReference(instance, job, ctx.Scheme); err != nil {
+			return reconcile.Result{}, err
+		}
+		glog.Infof("[%s/%s] snapshot: Creating on-demand snapshot Job %s/%s\n", instance.Namespace, instance.Name, job.Namespace, job.Name)
+		return reconcile.Result{}, client.IgnoreAlreadyExists(ctx.Create(ctx.Context, job))
+	} else if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if existing.Status.Succeeded > 0 {
+		// Reset TriggerNow so this on-demand request isn't re-run on every
+		// future reconcile; the next request sets it again and, since it
+		// also bumps TriggerGeneration, gets its own Job name above.
+		// Status.LastSnapshotRef itself is kept in sync generically by
+		// syncLastSnapshotRef, which also picks up Jobs the schedule's
+		// CronJob spawned on its own, not just this one-shot Job.
+		instance.Spec.Snapshot.TriggerNow = false
+		return reconcile.Result{}, ctx.Update(ctx.Context, instance)
+	}
+	return reconcile.Result{}, nil
+}
+
+// syncLastSnapshotRef points Status.LastSnapshotRef at the most recently
+// succeeded snapshot Job regardless of what created it - a TriggerNow
+// one-shot, or one the schedule's CronJob spawned on its own - so a user
+// watching Status.LastSnapshotRef sees scheduled backups too, not only
+// on-demand ones.
+func (comp *snapshotComponent) syncLastSnapshotRef(ctx *components.ComponentContext, instance *instancev1beta1.OdooInstance) error {
+	jobs := &batchv1.JobList{}
+	listoptions := client.InNamespace(instance.Namespace)
+	listoptions.MatchingLabels(map[string]string{
+		"instance.odoo.io/name": instance.Name,
+		"app.odoo.io/component": "snapshot",
+	})
+	if err := ctx.List(ctx.Context, listoptions, jobs); err != nil {
+		return err
+	}
+
+	var latest *batchv1.Job
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.Status.Succeeded == 0 {
+			continue
+		}
+		if latest == nil || latest.Status.CompletionTime.Before(job.Status.CompletionTime) {
+			latest = job
+		}
+	}
+	if latest == nil || (instance.Status.LastSnapshotRef != nil && instance.Status.LastSnapshotRef.Name == latest.Name) {
+		return nil
+	}
+
+	instance.Status.LastSnapshotRef = &instancev1beta1.SnapshotReference{
+		Name:      latest.Name,
+		Timestamp: latest.Status.CompletionTime,
+		Digest:    latest.Annotations["snapshot.odoo.io/digest"],
+	}
+	return ctx.Status().Update(ctx.Context, instance)
+}
+
+// oneShotSnapshotJobName derives a stable Job name from the instance's
+// identity and the current trigger generation, so repeated reconciles of the
+// same on-demand request address the same Job, but a later, distinct
+// TriggerNow request (which bumps TriggerGeneration) gets its own Job
+// instead of resolving to an already-succeeded one.
+func oneShotSnapshotJobName(instance *instancev1beta1.OdooInstance) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", instance.UID, instance.Spec.Snapshot.TriggerGeneration)))
+	return fmt.Sprintf("snapshot-%x", h[:8])
+}
+
+// pruneOldSnapshots deletes completed snapshot Jobs beyond Retention, oldest
+// first. Pruning the object backing store itself (S3/GCS/PVC) is left to the
+// snapshot image's own lifecycle rules; the operator only prunes the Jobs
+// (and the status history they imply) it created.
+func (comp *snapshotComponent) pruneOldSnapshots(ctx *components.ComponentContext, instance *instancev1beta1.OdooInstance) error {
+	retention := instance.Spec.Snapshot.Retention
+	if retention <= 0 {
+		return nil
+	}
+
+	jobs := &batchv1.JobList{}
+	listoptions := client.InNamespace(instance.Namespace)
+	listoptions.MatchingLabels(map[string]string{
+		"instance.odoo.io/name": instance.Name,
+		"app.odoo.io/component": "snapshot",
+	})
+	if err := ctx.List(ctx.Context, listoptions, jobs); err != nil {
+		return err
+	}
+
+	completed := make([]*batchv1.Job, 0, len(jobs.Items))
+	for i := range jobs.Items {
+		if jobs.Items[i].Status.Succeeded > 0 {
+			completed = append(completed, &jobs.Items[i])
+		}
+	}
+	if len(completed) <= int(retention) {
+		return nil
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		return completed[i].Status.CompletionTime.Before(completed[j].Status.CompletionTime)
+	})
+
+	for _, job := range completed[:len(completed)-int(retention)] {
+		glog.Infof("[%s/%s] snapshot: Pruning old snapshot Job %s/%s (retention=%d)\n", instance.Namespace, instance.Name, job.Namespace, job.Name, retention)
+		if err := ctx.Delete(ctx.Context, job); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("pruning snapshot job %s/%s: %w", job.Namespace, job.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+/*
+ * This file is part of the Odoo-Operator (R) project.
+ * Copyright (c) 2018-2018 XOE Corp. SAS
+ * Authors: David Arnold, et al.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ *
+ * ALTERNATIVE LICENCING OPTION
+ *
+ * You can be released from the requirements of the license by purchasing
+ * a commercial license. Buying such a license is mandatory as soon as you
+ * develop commercial activities involving the Odoo-Operator software without
+ * disclosing the source code of your own applications. These activities
+ * include: Offering paid services to a customer as an ASP, shipping Odoo-
+ * Operator with a closed source product.
+ *
+ */
+
+// Package odooinstance wires the component-based OdooInstance reconciler
+// into the shared manager.
+package odooinstance
+
+import (
+	"github.com/blaggacao/ridecell-operator/pkg/components"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	instancev1beta1 "github.com/xoe-labs/odoo-operator/pkg/apis/instance/v1beta1"
+
+	instancecomponents "github.com/odoo-operator/app-operator/pkg/controller/odooinstance/components"
+)
+
+// Add registers the OdooInstance reconciler and its components with mgr.
+//
+// elected is closed once this manager replica has won the leader election
+// Lease. It is threaded straight into the components that create or mutate
+// cluster state (the copier, snapshot, and restore components), which check
+// it themselves before doing any side-effectful work, so that a non-leader
+// replica - which still runs its informers and caches for fast failover -
+// never races the leader to create the same Job.
+func Add(mgr ctrl.Manager, elected <-chan struct{}) error {
+	return components.NewReconciler(mgr, &instancev1beta1.OdooInstance{},
+		instancecomponents.NewCopier(mgr, elected, "/etc/app-operator/templates/copier-job.yaml"),
+		instancecomponents.NewSnapshot(
+			elected,
+			"/etc/app-operator/templates/snapshot-cronjob.yaml",
+			"/etc/app-operator/templates/snapshot-job.yaml",
+		),
+		instancecomponents.NewRestore(elected, "/etc/app-operator/templates/restore-job.yaml"),
+	).SetupWithManager(mgr)
+}
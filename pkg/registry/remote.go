@@ -0,0 +1,155 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// moduleManifestLabel is the image config label a built Odoo image carries
+// its bundled module manifest under, when the Release doesn't name an
+// out-of-band ModuleSource.
+const moduleManifestLabel = "io.odoo.modules"
+
+// moduleManifestConfigMapKey is the data key a ModuleSource.ConfigMapRef is
+// expected to carry its raw JSON module list under.
+const moduleManifestConfigMapKey = "modules.json"
+
+// RemoteResolver is the default Resolver: it talks to a real OCI registry
+// over its v2 HTTP API using go-containerregistry, the same library crane
+// and cosign are built on. Client is used to read a ModuleSource.ConfigMapRef
+// when the Release names one.
+type RemoteResolver struct {
+	Client client.Client
+}
+
+func NewRemoteResolver(c client.Client) *RemoteResolver {
+	return &RemoteResolver{Client: c}
+}
+
+func (r *RemoteResolver) ResolveDigest(ctx context.Context, image string) (string, error) {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", fmt.Errorf("parsing image reference %q: %w", image, err)
+	}
+	desc, err := remote.Get(ref, remote.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("resolving %q against registry: %w", image, err)
+	}
+	return fmt.Sprintf("%s@%s", ref.Context().Name(), desc.Digest), nil
+}
+
+func (r *RemoteResolver) FetchModuleManifest(ctx context.Context, namespace, digest string, modules *ModuleSource) ([]Module, error) {
+	switch {
+	case modules == nil:
+		return fetchModuleManifestFromImage(ctx, digest)
+	case modules.OCIArtifactRef != "":
+		return fetchModuleManifestFromOCIArtifact(ctx, modules.OCIArtifactRef)
+	case modules.ConfigMapRef != "":
+		return r.fetchModuleManifestFromConfigMap(ctx, namespace, modules.ConfigMapRef)
+	case modules.GitRef != "":
+		return nil, fmt.Errorf("module manifest from a Git ref (%q) is not supported", modules.GitRef)
+	default:
+		return fetchModuleManifestFromImage(ctx, digest)
+	}
+}
+
+// fetchModuleManifestFromConfigMap reads the manifest from a ConfigMap in
+// namespace, under moduleManifestConfigMapKey.
+func (r *RemoteResolver) fetchModuleManifestFromConfigMap(ctx context.Context, namespace, name string) ([]Module, error) {
+	cm := &corev1.ConfigMap{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, cm); err != nil {
+		return nil, fmt.Errorf("fetching module manifest ConfigMap %s/%s: %w", namespace, name, err)
+	}
+	raw, ok := cm.Data[moduleManifestConfigMapKey]
+	if !ok {
+		return nil, fmt.Errorf("ConfigMap %s/%s has no %q key", namespace, name, moduleManifestConfigMapKey)
+	}
+	var decoded []Module
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+		return nil, fmt.Errorf("decoding module manifest from ConfigMap %s/%s: %w", namespace, name, err)
+	}
+	return decoded, nil
+}
+
+// fetchModuleManifestFromImage reads the manifest bundled with the image
+// itself, under moduleManifestLabel in its config.
+func fetchModuleManifestFromImage(ctx context.Context, digest string) ([]Module, error) {
+	ref, err := name.ParseReference(digest)
+	if err != nil {
+		return nil, fmt.Errorf("parsing resolved digest %q: %w", digest, err)
+	}
+	img, err := remote.Image(ref, remote.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("fetching image %q: %w", digest, err)
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("reading image config for %q: %w", digest, err)
+	}
+	raw, ok := cfg.Config.Labels[moduleManifestLabel]
+	if !ok {
+		return nil, fmt.Errorf("image %q has no %q label", digest, moduleManifestLabel)
+	}
+	var decoded []Module
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+		return nil, fmt.Errorf("decoding module manifest from %q: %w", digest, err)
+	}
+	return decoded, nil
+}
+
+// fetchModuleManifestFromOCIArtifact reads the manifest from a dedicated OCI
+// artifact reference, expected to carry exactly one layer holding the raw
+// JSON module list.
+func fetchModuleManifestFromOCIArtifact(ctx context.Context, artifactRef string) ([]Module, error) {
+	ref, err := name.ParseReference(artifactRef)
+	if err != nil {
+		return nil, fmt.Errorf("parsing module manifest artifact ref %q: %w", artifactRef, err)
+	}
+	img, err := remote.Image(ref, remote.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("fetching module manifest artifact %q: %w", artifactRef, err)
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("reading layers of module manifest artifact %q: %w", artifactRef, err)
+	}
+	if len(layers) != 1 {
+		return nil, fmt.Errorf("module manifest artifact %q must have exactly one layer, got %d", artifactRef, len(layers))
+	}
+	rc, err := layers[0].Uncompressed()
+	if err != nil {
+		return nil, fmt.Errorf("reading module manifest layer of %q: %w", artifactRef, err)
+	}
+	defer rc.Close()
+	raw, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("reading module manifest layer of %q: %w", artifactRef, err)
+	}
+	var decoded []Module
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, fmt.Errorf("decoding module manifest from %q: %w", artifactRef, err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,52 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package registry resolves OCI image references to immutable digests and
+// fetches the Odoo module manifest bundled alongside an image.
+package registry
+
+import "context"
+
+// Resolver talks to an image registry on behalf of the Release controller.
+// Implementations may hit the registry's v2 API directly or shell out to an
+// existing client; the controller only depends on this interface so it can
+// be faked in tests.
+type Resolver interface {
+	// ResolveDigest pins image (a tag or digest reference) to its immutable
+	// sha256 digest form, e.g. "registry/odoo:16.0" -> "registry/odoo@sha256:...".
+	ResolveDigest(ctx context.Context, image string) (string, error)
+
+	// FetchModuleManifest returns the list of Odoo addons and their versions
+	// for the given resolved digest. modules narrows the fetch to a
+	// specific OCI artifact, ConfigMap, or Git ref when the Release spec
+	// names one explicitly; namespace is the Release's own namespace, used
+	// to resolve a ConfigMapRef. Implementations may ignore modules and
+	// always read the manifest bundled with the image.
+	FetchModuleManifest(ctx context.Context, namespace, digest string, modules *ModuleSource) ([]Module, error)
+}
+
+// Module describes a single Odoo addon pinned by a Release.
+type Module struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// ModuleSource points at where the module manifest should be read from when
+// it isn't bundled with the image itself.
+type ModuleSource struct {
+	OCIArtifactRef string `json:"ociArtifactRef,omitempty"`
+	ConfigMapRef   string `json:"configMapRef,omitempty"`
+	GitRef         string `json:"gitRef,omitempty"`
+}
@@ -0,0 +1,134 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sigstore
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// cosignSignatureAnnotation is where cosign's "simple signing" format
+// stores the base64 signature on the signature image's sole layer
+// descriptor.
+const cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+// CosignVerifier verifies a cosign keypair signature: it fetches the
+// signature image cosign publishes alongside a signed digest (the
+// "<repo>:sha256-<hex>.sig" tag convention), reads the detached signature
+// off its layer annotation, and checks it against the signed payload (the
+// layer's raw bytes) with the supplied ECDSA public key.
+//
+// This verifies the keypair signature only; it does not check a Rekor
+// transparency-log inclusion proof, which is enough for the "bring your
+// own keypair" mode Spec.Verification.PublicKeyRef asks for.
+type CosignVerifier struct{}
+
+func NewCosignVerifier() *CosignVerifier {
+	return &CosignVerifier{}
+}
+
+func (v *CosignVerifier) Verify(ctx context.Context, digest string, publicKeyPEM []byte) error {
+	pub, err := parseECDSAPublicKey(publicKeyPEM)
+	if err != nil {
+		return fmt.Errorf("parsing verification public key: %w", err)
+	}
+
+	sigRef, err := signatureReference(digest)
+	if err != nil {
+		return err
+	}
+
+	img, err := remote.Image(sigRef, remote.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("fetching signature image %q: %w", sigRef, err)
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return fmt.Errorf("reading signature manifest for %q: %w", sigRef, err)
+	}
+	if len(manifest.Layers) != 1 {
+		return fmt.Errorf("signature image %q must have exactly one layer, got %d", sigRef, len(manifest.Layers))
+	}
+	sigB64, ok := manifest.Layers[0].Annotations[cosignSignatureAnnotation]
+	if !ok {
+		return fmt.Errorf("signature image %q is missing the %q annotation", sigRef, cosignSignatureAnnotation)
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigB64)
+	if err != nil {
+		return fmt.Errorf("decoding signature: %w", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return fmt.Errorf("reading layers of signature image %q: %w", sigRef, err)
+	}
+	rc, err := layers[0].Uncompressed()
+	if err != nil {
+		return fmt.Errorf("reading signed payload of %q: %w", sigRef, err)
+	}
+	defer rc.Close()
+	payload, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return fmt.Errorf("reading signed payload of %q: %w", sigRef, err)
+	}
+
+	hash := sha256.Sum256(payload)
+	if !ecdsa.VerifyASN1(pub, hash[:], sig) {
+		return fmt.Errorf("signature for %q does not match the provided public key", digest)
+	}
+	return nil
+}
+
+func parseECDSAPublicKey(pemBytes []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecdsaPub, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not ECDSA")
+	}
+	return ecdsaPub, nil
+}
+
+// signatureReference derives cosign's signature tag ("<repo>:sha256-<hex>.sig")
+// from a resolved "<repo>@sha256:<hex>" digest reference.
+func signatureReference(digest string) (name.Reference, error) {
+	ref, err := name.ParseReference(digest)
+	if err != nil {
+		return nil, fmt.Errorf("parsing digest %q: %w", digest, err)
+	}
+	digestRef, ok := ref.(name.Digest)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a digest reference", digest)
+	}
+	tag := strings.ReplaceAll(digestRef.DigestStr(), ":", "-") + ".sig"
+	return name.NewTag(fmt.Sprintf("%s:%s", digestRef.Context().Name(), tag))
+}
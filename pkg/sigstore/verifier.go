@@ -0,0 +1,28 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package sigstore verifies cosign/Sigstore signatures over resolved image
+// digests so a Release can be trusted as tamper-evident before it is rolled
+// out.
+package sigstore
+
+import "context"
+
+// Verifier checks a signature over digest against a PEM-encoded public key.
+// It returns a non-nil error when the signature is missing, malformed, or
+// doesn't match the key.
+type Verifier interface {
+	Verify(ctx context.Context, digest string, publicKeyPEM []byte) error
+}